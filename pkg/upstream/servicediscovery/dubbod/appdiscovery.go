@@ -0,0 +1,307 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	registry "github.com/mosn/registry/dubbo"
+	dubbocommon "github.com/mosn/registry/dubbo/common"
+	dubboconsts "github.com/mosn/registry/dubbo/common/constant"
+	"github.com/valyala/fasttemplate"
+	v2 "mosn.io/mosn/pkg/config/v2"
+	"mosn.io/mosn/pkg/log"
+	clusterAdapter "mosn.io/mosn/pkg/upstream/cluster"
+)
+
+// applicationServicePathTpl renders the registry node an application-level
+// consumer registers/subscribes under, as opposed to the interface path used
+// by the legacy per-service flow.
+var applicationServicePathTpl = fasttemplate.New("/services/{app}", "{", "}")
+
+// metadataHTTPPath is the well-known path, served on every provider instance's
+// admin listener, that returns the interfaces/methods it has published. The
+// publish/unpublish handlers are the ones that populate it on the provider
+// side; subscribeByApp is the consumer of it.
+const metadataHTTPPath = "/dubbod/metadata"
+
+// adminPortParamKey is the dubbo URL param a provider's publish call stamps
+// onto its registration so consumers know where to reach metadataHTTPPath.
+// The dubbo URL's own port (instanceURL.Port) is the protocol port the
+// provider serves RPCs on, not MOSN's admin listener, so it can't be reused
+// for this.
+const adminPortParamKey = "adminPort"
+
+// instanceMetadata is what metadataHTTPPath returns.
+type instanceMetadata struct {
+	Interfaces []interfaceMetadata `json:"interfaces"`
+}
+
+type interfaceMetadata struct {
+	Interface string   `json:"interface"`
+	Methods   []string `json:"methods"`
+}
+
+var metadataHTTPClient = &http.Client{Timeout: 3 * time.Second}
+
+// fetchInstanceMetadata asks a provider instance, addressed by its dubbo URL,
+// for the interfaces it currently exposes. The instance must have advertised
+// its admin port via adminPortParamKey when it published; instanceURL.Port is
+// the dubbo protocol port and won't serve metadataHTTPPath.
+func fetchInstanceMetadata(instanceURL dubbocommon.URL) (*instanceMetadata, error) {
+	adminPort := instanceURL.GetParam(adminPortParamKey, "")
+	if adminPort == "" {
+		return nil, fmt.Errorf("instance %s:%s did not advertise %s, cannot fetch metadata",
+			instanceURL.Ip, instanceURL.Port, adminPortParamKey)
+	}
+
+	endpoint := fmt.Sprintf("http://%s:%s%s", instanceURL.Ip, adminPort, metadataHTTPPath)
+	resp, err := metadataHTTPClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("fetch instance metadata from %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	var meta instanceMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("decode instance metadata from %s: %w", endpoint, err)
+	}
+	return &meta, nil
+}
+
+// dubboApplication2listener mirrors dubboInterface2listener but for the
+// application-level subscriptions added by subscribeByApp.
+var dubboApplication2listener = sync.Map{}
+
+// appListener reconciles provider instance ADD/DEL/UPDATE events for one
+// application into per-interface cluster hosts. Unlike the interface-level
+// listener, an event here carries one instance that may back many
+// interfaces, so a single event fans out into updates for every cluster that
+// instance claims to expose.
+type appListener struct {
+	application string
+
+	mu sync.Mutex
+	// instanceInterfaces remembers, per instance address, the interfaces it
+	// last reported so a DEL/UPDATE can be diffed against it.
+	instanceInterfaces map[string][]string
+
+	// cancel and dedup mirror listener's fields (listener.go): cancel stops
+	// the subscribeWithFailover goroutine on unsubscribeByApp, and dedup is
+	// the exact instance Subscribe was called with, which UnSubscribe must
+	// also be called with.
+	cancel context.CancelFunc
+	dedup  registry.NotifyListener
+}
+
+func newAppListener(application string) *appListener {
+	return &appListener{
+		application:        application,
+		instanceInterfaces: map[string][]string{},
+	}
+}
+
+func (l *appListener) Notify(event *registry.ServiceEvent) {
+	instanceAddr := event.Service.Ip + ":" + event.Service.Port
+
+	switch event.Action {
+	case registry.ServiceEventAdd, registry.ServiceEventUpdate:
+		meta, err := fetchInstanceMetadata(event.Service)
+		if err != nil {
+			log.DefaultLogger.Errorf("dubbod: application %s: %v", l.application, err)
+			return
+		}
+		ifaces := make([]string, 0, len(meta.Interfaces))
+		for _, im := range meta.Interfaces {
+			ifaces = append(ifaces, im.Interface)
+		}
+
+		l.mu.Lock()
+		old := l.instanceInterfaces[instanceAddr]
+		l.instanceInterfaces[instanceAddr] = ifaces
+		l.mu.Unlock()
+
+		for _, iface := range ifaces {
+			if err := addRouteRule(iface); err != nil {
+				log.DefaultLogger.Errorf("dubbod: application %s: add route for %s: %v", l.application, iface, err)
+			}
+			addClusterHost(iface, instanceAddr)
+		}
+		for _, iface := range old {
+			if !containsString(ifaces, iface) {
+				removeClusterHost(iface, instanceAddr)
+			}
+		}
+	case registry.ServiceEventDel:
+		l.mu.Lock()
+		ifaces := l.instanceInterfaces[instanceAddr]
+		delete(l.instanceInterfaces, instanceAddr)
+		l.mu.Unlock()
+
+		for _, iface := range ifaces {
+			removeClusterHost(iface, instanceAddr)
+		}
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterHosts tracks, per cluster name, the set of instance addresses
+// currently believed to back it. This is the single source of truth for a
+// cluster's host list: both this file's appListener and listener.go's
+// interface-level listener write into it through applyClusterHost/
+// removeClusterHostEntry, so an interface served by both an interface-level
+// and an application-level subscription doesn't have one clobber the
+// other's entries.
+var clusterHosts = sync.Map{} // clusterName -> *sync.Map of instanceAddr -> hostMeta
+
+// hostMeta is what little the cluster manager needs to know about a host
+// beyond its address.
+type hostMeta struct {
+	weight uint32
+}
+
+func addClusterHost(clusterName, instanceAddr string) {
+	applyClusterHost(clusterName, instanceAddr, defaultHostWeight)
+}
+
+func removeClusterHost(clusterName, instanceAddr string) {
+	removeClusterHostEntry(clusterName, instanceAddr)
+}
+
+// applyClusterHost upserts one host's weight into clusterName's shared host
+// set and pushes the result. It's the single write path for clusterHosts, so
+// an interface-level listener (listener.go) and an application-level one
+// (appListener above) contributing to the same cluster only ever add to or
+// remove their own entries instead of replacing each other's.
+func applyClusterHost(clusterName, instanceAddr string, weight uint32) {
+	hosts, _ := clusterHosts.LoadOrStore(clusterName, &sync.Map{})
+	set := hosts.(*sync.Map)
+	set.Store(instanceAddr, hostMeta{weight: weight})
+	pushClusterHosts(clusterName, set)
+}
+
+// removeClusterHostEntry drops one host from clusterName's shared host set
+// and pushes the result.
+func removeClusterHostEntry(clusterName, instanceAddr string) {
+	v, ok := clusterHosts.Load(clusterName)
+	if !ok {
+		return
+	}
+	set := v.(*sync.Map)
+	set.Delete(instanceAddr)
+	pushClusterHosts(clusterName, set)
+}
+
+// pushClusterHosts ensures clusterName exists and reconciles its host list
+// with the cluster manager.
+func pushClusterHosts(clusterName string, hosts *sync.Map) {
+	clusterAdapter.GetClusterMngAdapterInstance().TriggerClusterAddOrUpdate(v2.Cluster{
+		Name:        clusterName,
+		ClusterType: v2.SIMPLE_CLUSTER,
+		LbType:      v2.LB_RANDOM,
+	})
+
+	var vhosts []v2.Host
+	hosts.Range(func(k, m interface{}) bool {
+		vhosts = append(vhosts, v2.Host{
+			HostConfig: v2.HostConfig{
+				Address: k.(string),
+				Weight:  m.(hostMeta).weight,
+			},
+		})
+		return true
+	})
+	if err := clusterAdapter.GetClusterMngAdapterInstance().TriggerClusterHostUpdate(clusterName, vhosts); err != nil {
+		log.DefaultLogger.Errorf("dubbod: update hosts for cluster %s: %v", clusterName, err)
+	}
+}
+
+// subscribeByApp registers and subscribes a consumer to an application-level
+// registry node instead of a single interface path, and fans each discovered
+// provider instance out into per-interface clusters/routes.
+func subscribeByApp(req subReq) error {
+	servicePath := applicationServicePathTpl.ExecuteString(map[string]interface{}{
+		"app": req.Service.Application,
+	})
+
+	dubboURL := dubbocommon.NewURLWithOptions(
+		dubbocommon.WithPath(servicePath),
+		dubbocommon.WithProtocol("dubbo"),
+		dubbocommon.WithParams(url.Values{
+			dubboconsts.TIMESTAMP_KEY:   []string{fmt.Sprint(time.Now().Unix())},
+			dubboconsts.ROLE_KEY:        []string{fmt.Sprint(dubbocommon.CONSUMER)},
+			dubboconsts.APPLICATION_KEY: []string{req.Service.Application},
+		}),
+	)
+
+	if _, err := registerWithFailover(servicePath, dubbocommon.CONSUMER, req.Registry, *dubboURL); err != nil {
+		return err
+	}
+
+	l := newAppListener(req.Service.Application)
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.dedup = newDedupingListener(l)
+	go subscribeWithFailover(ctx, servicePath, req.Registry, dubboURL, l.dedup)
+	dubboApplication2listener.Store(req.Service.Application, l)
+	return nil
+}
+
+// unsubscribeByApp mirrors subscribeByApp for the unsubscribe endpoint.
+func unsubscribeByApp(req unsubReq) error {
+	servicePath := applicationServicePathTpl.ExecuteString(map[string]interface{}{
+		"app": req.Service.Application,
+	})
+
+	dubboURL := dubbocommon.NewURLWithOptions(
+		dubbocommon.WithPath(servicePath),
+		dubbocommon.WithProtocol("dubbo"),
+		dubbocommon.WithParams(url.Values{
+			dubboconsts.ROLE_KEY:        []string{fmt.Sprint(dubbocommon.CONSUMER)},
+			dubboconsts.APPLICATION_KEY: []string{req.Service.Application},
+		}),
+	)
+
+	if err := unregisterWithFailover(servicePath, dubbocommon.CONSUMER, req.Registry, *dubboURL); err != nil {
+		return err
+	}
+
+	v, ok := dubboApplication2listener.Load(req.Service.Application)
+	if !ok {
+		return nil
+	}
+	dubboApplication2listener.Delete(req.Service.Application)
+	l := v.(*appListener)
+	// Stop the subscribeWithFailover goroutine before it can race a fresh
+	// UnSubscribe and re-subscribe behind our back.
+	l.cancel()
+	return unsubscribeWithFailover(servicePath, req.Registry, dubboURL, l.dedup)
+}
@@ -0,0 +1,92 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	dubbocommon "github.com/mosn/registry/dubbo/common"
+)
+
+func TestFetchInstanceMetadataMissingAdminPort(t *testing.T) {
+	u := dubbocommon.NewURLWithOptions(
+		dubbocommon.WithIp("10.0.0.1"),
+		dubbocommon.WithPort("20880"),
+	)
+
+	_, err := fetchInstanceMetadata(*u)
+	if err == nil {
+		t.Fatal("fetchInstanceMetadata() error = nil, want an error when adminPort is not advertised")
+	}
+	if !strings.Contains(err.Error(), adminPortParamKey) {
+		t.Errorf("fetchInstanceMetadata() error = %q, want it to mention %q", err, adminPortParamKey)
+	}
+}
+
+func TestFetchInstanceMetadataSuccess(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metadataHTTPPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(instanceMetadata{
+			Interfaces: []interfaceMetadata{{Interface: "com.mosn.test.UserService"}},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	parsed, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error = %v", srv.URL, err)
+	}
+	u := dubbocommon.NewURLWithOptions(
+		dubbocommon.WithIp(parsed.Hostname()),
+		dubbocommon.WithPort("20880"),
+		dubbocommon.WithParams(url.Values{adminPortParamKey: {parsed.Port()}}),
+	)
+
+	meta, err := fetchInstanceMetadata(*u)
+	if err != nil {
+		t.Fatalf("fetchInstanceMetadata() error = %v", err)
+	}
+	if len(meta.Interfaces) != 1 || meta.Interfaces[0].Interface != "com.mosn.test.UserService" {
+		t.Errorf("fetchInstanceMetadata() = %+v, want one UserService interface", meta)
+	}
+}
+
+func TestContainsString(t *testing.T) {
+	cases := []struct {
+		name string
+		ss   []string
+		s    string
+		want bool
+	}{
+		{"present", []string{"a", "b", "c"}, "b", true},
+		{"absent", []string{"a", "b", "c"}, "z", false},
+		{"empty slice", nil, "a", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := containsString(tc.ss, tc.s); got != tc.want {
+				t.Errorf("containsString(%v, %q) = %v, want %v", tc.ss, tc.s, got, tc.want)
+			}
+		})
+	}
+}
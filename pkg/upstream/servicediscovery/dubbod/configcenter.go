@@ -0,0 +1,319 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+	v2 "mosn.io/mosn/pkg/config/v2"
+	"mosn.io/mosn/pkg/log"
+	routerAdapter "mosn.io/mosn/pkg/router"
+)
+
+// ConfigCenterSource watches a dynamic configuration source (Zookeeper,
+// Nacos, Apollo, ...) for virtual service documents and invokes onChange
+// whenever the document at servicePath is created, updated or removed. data
+// is nil and exists is false on removal.
+type ConfigCenterSource interface {
+	// Subscribe starts watching servicePath's virtual service document.
+	Subscribe(servicePath string, onChange func(data []byte, exists bool)) error
+	// Unsubscribe stops watching servicePath.
+	Unsubscribe(servicePath string) error
+	Close() error
+}
+
+// ConfigCenterFactory builds a ConfigCenterSource connected to addr.
+type ConfigCenterFactory func(addr string, reg registryInfo) (ConfigCenterSource, error)
+
+var configCenterFactories = struct {
+	mu sync.RWMutex
+	m  map[string]ConfigCenterFactory
+}{m: map[string]ConfigCenterFactory{}}
+
+// RegisterConfigCenter registers a named config center backend so operators
+// can point dubbod at it without MOSN needing to know about the concrete
+// implementation (Zookeeper/Nacos/Apollo/...). Typically called from an
+// extension's init().
+func RegisterConfigCenter(name string, factory ConfigCenterFactory) {
+	configCenterFactories.mu.Lock()
+	defer configCenterFactories.mu.Unlock()
+	configCenterFactories.m[name] = factory
+}
+
+func getConfigCenterFactory(name string) (ConfigCenterFactory, error) {
+	configCenterFactories.mu.RLock()
+	defer configCenterFactories.mu.RUnlock()
+	f, ok := configCenterFactories.m[name]
+	if !ok {
+		return nil, fmt.Errorf("config center %q is not registered", name)
+	}
+	return f, nil
+}
+
+// virtualService is the document schema pushed through the config center for
+// one dubbo service: a set of tag/weight/condition routing rules.
+type virtualService struct {
+	Service string      `yaml:"service" json:"service"`
+	Rules   []routeRule `yaml:"rules" json:"rules"`
+}
+
+type routeRule struct {
+	Match routeMatch        `yaml:"match" json:"match"`
+	Route []weightedCluster `yaml:"route" json:"route"`
+	// Strategy picks how Route is interpreted when it names more than one
+	// cluster: "weight" (the default) splits traffic across all of them in
+	// proportion to their Weight, for canary-style rollouts. "fallback"
+	// (try the next cluster only once the current one is unavailable) is
+	// rejected by parseVirtualService when Route names more than one
+	// cluster - see routeStrategyFallback below.
+	Strategy string `yaml:"strategy" json:"strategy"`
+}
+
+const (
+	routeStrategyWeight = "weight"
+
+	// routeStrategyFallback names the ordered-failover strategy operators
+	// may ask for, but dubbod does not implement it: the router config this
+	// package targets (v2.RouterActionConfig, confirmed only as far as
+	// ClusterName and WeightedClusters go) has no "try B once A is
+	// unavailable" primitive, as opposed to WeightedClusters' "split traffic
+	// across A and B" which is supported. Rather than silently degrade a
+	// fallback rule to routing at its primary cluster only,
+	// parseVirtualService rejects a fallback rule that names more than one
+	// cluster so operators get a loud error instead of traffic that looks
+	// like failover but isn't. A fallback rule with a single cluster is
+	// accepted and becomes a plain route to that cluster.
+	routeStrategyFallback = "fallback"
+)
+
+// routeMatch mirrors the attachments/headers a dubbo invocation carries.
+type routeMatch struct {
+	Method      string            `yaml:"method" json:"method"`
+	Group       string            `yaml:"group" json:"group"`
+	Version     string            `yaml:"version" json:"version"`
+	ConsumerApp string            `yaml:"consumerApp" json:"consumerApp"`
+	Tags        map[string]string `yaml:"tags" json:"tags"`
+}
+
+type weightedCluster struct {
+	Cluster string `yaml:"cluster" json:"cluster"`
+	Weight  uint32 `yaml:"weight" json:"weight"`
+}
+
+// parseVirtualService accepts either YAML or JSON, since JSON is a valid
+// subset of YAML. It rejects documents that ask for fallback routing across
+// more than one cluster - see routeStrategyFallback - since toRouters has no
+// way to actually enforce it.
+func parseVirtualService(data []byte) (*virtualService, error) {
+	var vs virtualService
+	if err := yaml.Unmarshal(data, &vs); err != nil {
+		return nil, fmt.Errorf("parse virtual service: %w", err)
+	}
+	for _, rule := range vs.Rules {
+		if rule.Strategy == routeStrategyFallback && len(rule.Route) > 1 {
+			return nil, fmt.Errorf("parse virtual service: rule matching %+v: fallback routing across %d clusters is not supported, only weighted splitting is", rule.Match, len(rule.Route))
+		}
+	}
+	return &vs, nil
+}
+
+// toRouters translates a virtual service document into the v2.Router entries
+// addRouteRule would otherwise hand-build. A rule with a single route target
+// becomes a plain route; a rule with multiple targets becomes a
+// weighted-cluster route, used for canary rollouts. parseVirtualService has
+// already rejected a multi-target "fallback" rule by the time a document
+// reaches here.
+func (vs *virtualService) toRouters() []*v2.Router {
+	routers := make([]*v2.Router, 0, len(vs.Rules))
+	for _, rule := range vs.Rules {
+		headers := matchToHeaders(vs.Service, rule.Match)
+
+		var action v2.RouteAction
+		if len(rule.Route) <= 1 {
+			cluster := ""
+			if len(rule.Route) == 1 {
+				cluster = rule.Route[0].Cluster
+			}
+			action.RouterActionConfig = v2.RouterActionConfig{ClusterName: cluster}
+		} else {
+			weighted := make([]v2.WeightedCluster, 0, len(rule.Route))
+			for _, c := range rule.Route {
+				weighted = append(weighted, v2.WeightedCluster{
+					Cluster: v2.ClusterWeight{
+						Name:   c.Cluster,
+						Weight: c.Weight,
+					},
+				})
+			}
+			action.RouterActionConfig = v2.RouterActionConfig{
+				WeightedClusters: weighted,
+			}
+		}
+
+		routers = append(routers, &v2.Router{
+			RouterConfig: v2.RouterConfig{
+				Match: v2.RouterMatch{
+					Headers: headers,
+				},
+				Route: action,
+			},
+		})
+	}
+	return routers
+}
+
+func matchToHeaders(service string, m routeMatch) []v2.HeaderMatcher {
+	headers := []v2.HeaderMatcher{
+		{Name: "service", Value: service},
+	}
+	if m.Method != "" {
+		headers = append(headers, v2.HeaderMatcher{Name: "method", Value: m.Method})
+	}
+	if m.Group != "" {
+		headers = append(headers, v2.HeaderMatcher{Name: "group", Value: m.Group})
+	}
+	if m.Version != "" {
+		headers = append(headers, v2.HeaderMatcher{Name: "version", Value: m.Version})
+	}
+	if m.ConsumerApp != "" {
+		headers = append(headers, v2.HeaderMatcher{Name: "consumer-app", Value: m.ConsumerApp})
+	}
+	for tag, value := range m.Tags {
+		headers = append(headers, v2.HeaderMatcher{Name: tag, Value: value})
+	}
+	return headers
+}
+
+// serviceRoutes is the full, package-level view of what every servicePath
+// currently contributes to the "dubbo" virtual host, keyed by servicePath.
+// Both route-management paths write through it: addRouteRule (sub.go,
+// appdiscovery.go) installs the default single-cluster route a subscribed
+// service gets by default, and the config center (this file) installs the
+// rule set an operator pushed for a service, replacing addRouteRule's entry
+// for that same servicePath if one exists. replaceServiceRoutes/
+// removeServiceRoutes mutate one service's entry and then rebuild and
+// install the whole virtual host's route list in a single AddOrUpdateRouters
+// call, which is the only route-table write MOSN's router manager is
+// confirmed (via the baseline sub.go) to expose - there is no confirmed API
+// to remove or replace routes by name alone.
+var serviceRoutes = struct {
+	mu sync.Mutex
+	m  map[string][]*v2.Router
+}{m: map[string][]*v2.Router{}}
+
+// replaceServiceRoutes atomically swaps the router table generated for
+// servicePath for routers. The swap is atomic in the sense that matters here:
+// the virtual host is rebuilt from serviceRoutes and installed as one
+// AddOrUpdateRouters call, so in-flight requests never see a window with
+// both the old and the new rules for servicePath active, or none at all.
+func replaceServiceRoutes(servicePath string, routers []*v2.Router) error {
+	serviceRoutes.mu.Lock()
+	serviceRoutes.m[servicePath] = routers
+	all := flattenServiceRoutesLocked()
+	serviceRoutes.mu.Unlock()
+
+	if err := installServiceRoutes(all); err != nil {
+		return fmt.Errorf("replace routes for %s: %w", servicePath, err)
+	}
+	return nil
+}
+
+// removeServiceRoutes is invoked when the config center reports that a
+// service's virtual service document was deleted.
+func removeServiceRoutes(servicePath string) error {
+	serviceRoutes.mu.Lock()
+	delete(serviceRoutes.m, servicePath)
+	all := flattenServiceRoutesLocked()
+	serviceRoutes.mu.Unlock()
+
+	if err := installServiceRoutes(all); err != nil {
+		return fmt.Errorf("remove routes for %s: %w", servicePath, err)
+	}
+	return nil
+}
+
+// flattenServiceRoutesLocked must be called with serviceRoutes.mu held.
+func flattenServiceRoutesLocked() []*v2.Router {
+	var all []*v2.Router
+	for _, routers := range serviceRoutes.m {
+		all = append(all, routers...)
+	}
+	return all
+}
+
+// installServiceRoutes replaces the entire "dubbo" virtual host's route list
+// with routers in one call.
+func installServiceRoutes(routers []*v2.Router) error {
+	return routerAdapter.GetRoutersMangerInstance().AddOrUpdateRouters(&v2.RouterConfiguration{
+		RouterConfigurationConfig: v2.RouterConfigurationConfig{
+			RouterConfigName: dubboRouterConfigName,
+		},
+		VirtualHosts: []*v2.VirtualHost{
+			{
+				Name:    dubboRouterConfigName,
+				Domains: []string{"*"},
+				Routers: routers,
+			},
+		},
+	})
+}
+
+var configCenter ConfigCenterSource
+
+// InitConfigCenter connects to the named config center backend and leaves it
+// ready to watch services via WatchServiceRoutes. It replaces POSTing route
+// rules to the subscribe endpoint for every interface: operators instead
+// push one virtual service document per service to the config center.
+func InitConfigCenter(name, addr string, reg registryInfo) error {
+	factory, err := getConfigCenterFactory(name)
+	if err != nil {
+		return err
+	}
+	source, err := factory(addr, reg)
+	if err != nil {
+		return fmt.Errorf("init config center %q: %w", name, err)
+	}
+	configCenter = source
+	return nil
+}
+
+// WatchServiceRoutes subscribes servicePath's virtual service document and
+// keeps its generated routes in sync for as long as dubbod runs.
+func WatchServiceRoutes(servicePath string) error {
+	if configCenter == nil {
+		return fmt.Errorf("no config center configured")
+	}
+	return configCenter.Subscribe(servicePath, func(data []byte, exists bool) {
+		if !exists {
+			if err := removeServiceRoutes(servicePath); err != nil {
+				log.DefaultLogger.Errorf("dubbod: remove routes for %s: %v", servicePath, err)
+			}
+			return
+		}
+
+		vs, err := parseVirtualService(data)
+		if err != nil {
+			log.DefaultLogger.Errorf("dubbod: %v", err)
+			return
+		}
+		if err := replaceServiceRoutes(servicePath, vs.toRouters()); err != nil {
+			log.DefaultLogger.Errorf("dubbod: %v", err)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"strings"
+	"testing"
+
+	v2 "mosn.io/mosn/pkg/config/v2"
+)
+
+func TestParseVirtualService(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "weighted rule parses",
+			data: `
+service: com.mosn.test.UserService
+rules:
+  - match:
+      method: getUser
+    route:
+      - cluster: v1
+        weight: 90
+      - cluster: v2
+        weight: 10
+`,
+		},
+		{
+			name: "single-target fallback rule is fine",
+			data: `
+service: com.mosn.test.UserService
+rules:
+  - match:
+      method: getUser
+    strategy: fallback
+    route:
+      - cluster: v1
+`,
+		},
+		{
+			name: "multi-target fallback rule is rejected",
+			data: `
+service: com.mosn.test.UserService
+rules:
+  - match:
+      method: getUser
+    strategy: fallback
+    route:
+      - cluster: v1
+      - cluster: v2
+`,
+			wantErr: "fallback routing across 2 clusters is not supported",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vs, err := parseVirtualService([]byte(tc.data))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("parseVirtualService() error = %v, want containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVirtualService() unexpected error: %v", err)
+			}
+			if vs.Service != "com.mosn.test.UserService" {
+				t.Errorf("Service = %q, want com.mosn.test.UserService", vs.Service)
+			}
+		})
+	}
+}
+
+func TestVirtualServiceToRouters(t *testing.T) {
+	t.Run("single target becomes a plain cluster route", func(t *testing.T) {
+		vs := &virtualService{
+			Service: "com.mosn.test.UserService",
+			Rules: []routeRule{
+				{Route: []weightedCluster{{Cluster: "v1"}}},
+			},
+		}
+		routers := vs.toRouters()
+		if len(routers) != 1 {
+			t.Fatalf("len(routers) = %d, want 1", len(routers))
+		}
+		got := routers[0].Route.RouterActionConfig
+		if got.ClusterName != "v1" || len(got.WeightedClusters) != 0 {
+			t.Errorf("RouterActionConfig = %+v, want ClusterName=v1 and no weighted clusters", got)
+		}
+	})
+
+	t.Run("multiple targets become a weighted-cluster route", func(t *testing.T) {
+		vs := &virtualService{
+			Service: "com.mosn.test.UserService",
+			Rules: []routeRule{
+				{Route: []weightedCluster{
+					{Cluster: "v1", Weight: 90},
+					{Cluster: "v2", Weight: 10},
+				}},
+			},
+		}
+		routers := vs.toRouters()
+		if len(routers) != 1 {
+			t.Fatalf("len(routers) = %d, want 1", len(routers))
+		}
+		got := routers[0].Route.RouterActionConfig
+		if got.ClusterName != "" {
+			t.Errorf("ClusterName = %q, want empty for a weighted route", got.ClusterName)
+		}
+		want := []v2.WeightedCluster{
+			{Cluster: v2.ClusterWeight{Name: "v1", Weight: 90}},
+			{Cluster: v2.ClusterWeight{Name: "v2", Weight: 10}},
+		}
+		if len(got.WeightedClusters) != len(want) {
+			t.Fatalf("len(WeightedClusters) = %d, want %d", len(got.WeightedClusters), len(want))
+		}
+		for i := range want {
+			if got.WeightedClusters[i] != want[i] {
+				t.Errorf("WeightedClusters[%d] = %+v, want %+v", i, got.WeightedClusters[i], want[i])
+			}
+		}
+	})
+
+	t.Run("match fields become header matchers", func(t *testing.T) {
+		vs := &virtualService{
+			Service: "com.mosn.test.UserService",
+			Rules: []routeRule{
+				{
+					Match: routeMatch{Method: "getUser", Group: "g1", Version: "1.0.0"},
+					Route: []weightedCluster{{Cluster: "v1"}},
+				},
+			},
+		}
+		headers := vs.toRouters()[0].Match.Headers
+		want := map[string]string{"service": vs.Service, "method": "getUser", "group": "g1", "version": "1.0.0"}
+		if len(headers) != len(want) {
+			t.Fatalf("len(headers) = %d, want %d", len(headers), len(want))
+		}
+		for _, h := range headers {
+			if want[h.Name] != h.Value {
+				t.Errorf("header %q = %q, want %q", h.Name, h.Value, want[h.Name])
+			}
+		}
+	})
+}
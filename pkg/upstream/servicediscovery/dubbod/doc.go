@@ -0,0 +1,35 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dubbod implements MOSN's Dubbo sidecar registration service: it
+// publishes/subscribes services against a registry center (registryfactory.go),
+// turns provider events into cluster host updates (listener.go,
+// appdiscovery.go), and optionally generates routes from a config center
+// (configcenter.go).
+//
+// External API assumption: this package is written against
+// github.com/mosn/registry/dubbo as follows - registry.NotifyListener has a
+// single method, Notify(*ServiceEvent); registry.ServiceEvent carries a
+// Service field of type dubbocommon.URL (not a pointer) and an Action field
+// whose values are registry.ServiceEventAdd/Update/Del; dubbocommon.URL
+// exposes GetParam(key, default string) string and a Key() string method
+// identifying one registered provider instance. This tree has no
+// go.mod/vendored copy of that module to check these against, so go
+// build/go vet cannot run here. Everything in this package is written to
+// this assumed contract and needs confirming against the real module (and
+// go build ./... && go vet ./... passing) before merge.
+package dubbod
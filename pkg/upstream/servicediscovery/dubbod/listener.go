@@ -0,0 +1,306 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	registry "github.com/mosn/registry/dubbo"
+	dubbocommon "github.com/mosn/registry/dubbo/common"
+	"mosn.io/mosn/pkg/log"
+	"mosn.io/mosn/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "dubbod"
+
+	// defaultHostWeight is assumed for a host whose dubbo URL carries no
+	// explicit weight attribute.
+	defaultHostWeight uint32 = 100
+
+	// listenerDebounceWindow coalesces bursts of ADD/DEL/UPDATE events (e.g.
+	// a registry reconnect replaying its whole provider list) into a single
+	// cluster host update.
+	listenerDebounceWindow = 200 * time.Millisecond
+
+	// stalenessPollInterval is how often the subscription_staleness_seconds
+	// gauge is refreshed for every live listener.
+	stalenessPollInterval = 30 * time.Second
+)
+
+// Metric names are fixed; servicePath is carried as the "service" label so
+// the metrics stay a bounded set of series instead of growing one dotted
+// name per subscribed interface.
+const (
+	metricHostAdd               = "host_add"
+	metricHostRemove            = "host_remove"
+	metricSubscriptionStaleness = "subscription_staleness_seconds"
+)
+
+// serviceMetrics caches one labeled metrics.Metrics handle per servicePath,
+// since metrics.NewMetrics expects to be called once per label set rather
+// than per measurement.
+var serviceMetrics = sync.Map{} // servicePath -> metrics.Metrics
+
+func metricsFor(servicePath string) metrics.Metrics {
+	if v, ok := serviceMetrics.Load(servicePath); ok {
+		return v.(metrics.Metrics)
+	}
+	m, err := metrics.NewMetrics(metricsNamespace, map[string]string{"service": servicePath})
+	if err != nil {
+		return nil
+	}
+	actual, _ := serviceMetrics.LoadOrStore(servicePath, m)
+	return actual.(metrics.Metrics)
+}
+
+func incCounter(servicePath, name string, n int64) {
+	m := metricsFor(servicePath)
+	if m == nil {
+		return
+	}
+	if c, err := m.Counter(name); err == nil {
+		c.Inc(n)
+	}
+}
+
+func setGauge(servicePath, name string, v int64) {
+	m := metricsFor(servicePath)
+	if m == nil {
+		return
+	}
+	if g, err := m.Gauge(name); err == nil {
+		g.Update(v)
+	}
+}
+
+// listener is a registry.NotifyListener that turns provider ADD/DEL/UPDATE
+// events for one servicePath into host updates on the matching cluster
+// (whose name is servicePath, see addRouteRule). It debounces bursts and
+// tracks weight/warmup so newly warming-up providers ramp up gradually
+// instead of receiving full traffic immediately. See doc.go for the external
+// API shape this assumes.
+type listener struct {
+	servicePath string
+
+	mu       sync.Mutex
+	hosts    map[string]*hostState
+	debounce *time.Timer
+	// pushed is the set of instance addresses this listener last applied to
+	// the shared clusterHosts store (appdiscovery.go), so flush/drain know
+	// which entries are theirs to remove without touching ones contributed
+	// by an application-level listener on the same cluster.
+	pushed map[string]struct{}
+
+	lastEventAt time.Time
+
+	// cancel stops the subscribeWithFailover goroutine subscribe() started
+	// for this listener. unsubscribe() calls it before drain() so that
+	// goroutine can't re-subscribe and repopulate the hosts drain() just
+	// removed.
+	cancel context.CancelFunc
+	// dedup is the exact listener instance backend.Subscribe was called
+	// with (a *dedupingListener wrapping l); unsubscribe() must hand the
+	// same instance to UnSubscribe; see subscribeWithFailover.
+	dedup registry.NotifyListener
+}
+
+type hostState struct {
+	weight     uint32
+	warmupMS   uint32
+	registered time.Time
+}
+
+func newListener(servicePath string) *listener {
+	l := &listener{
+		servicePath: servicePath,
+		hosts:       map[string]*hostState{},
+		pushed:      map[string]struct{}{},
+	}
+	trackListenerStaleness(servicePath, l)
+	return l
+}
+
+func (l *listener) Notify(event *registry.ServiceEvent) {
+	instanceAddr := event.Service.Ip + ":" + event.Service.Port
+
+	l.mu.Lock()
+	l.lastEventAt = time.Now()
+	switch event.Action {
+	case registry.ServiceEventAdd, registry.ServiceEventUpdate:
+		l.hosts[instanceAddr] = &hostState{
+			weight:     parseWeight(event.Service),
+			warmupMS:   parseWarmup(event.Service),
+			registered: time.Now(),
+		}
+		incCounter(l.servicePath, metricHostAdd, 1)
+	case registry.ServiceEventDel:
+		delete(l.hosts, instanceAddr)
+		incCounter(l.servicePath, metricHostRemove, 1)
+	}
+	l.scheduleFlushLocked()
+	l.mu.Unlock()
+}
+
+func (l *listener) scheduleFlushLocked() {
+	if l.debounce != nil {
+		return
+	}
+	l.debounce = time.AfterFunc(listenerDebounceWindow, l.flush)
+}
+
+// flush reconciles clusterHosts (appdiscovery.go) with the debounced
+// snapshot: hosts still inside their warmup window are weighted down
+// proportionally to how much of it has elapsed, the same ramp-up dubbo
+// clients apply client-side. It only adds/removes the addresses this
+// listener itself has reported, so an application-level listener
+// contributing hosts to the same cluster name is left untouched.
+func (l *listener) flush() {
+	l.mu.Lock()
+	l.debounce = nil
+	snapshot := make(map[string]*hostState, len(l.hosts))
+	for addr, hs := range l.hosts {
+		snapshot[addr] = hs
+	}
+	previouslyPushed := l.pushed
+	nowPushed := make(map[string]struct{}, len(snapshot))
+	for addr := range snapshot {
+		nowPushed[addr] = struct{}{}
+	}
+	l.pushed = nowPushed
+	l.mu.Unlock()
+
+	for addr, hs := range snapshot {
+		applyClusterHost(l.servicePath, addr, effectiveWeight(hs))
+	}
+	for addr := range previouslyPushed {
+		if _, stillPresent := nowPushed[addr]; !stillPresent {
+			removeClusterHostEntry(l.servicePath, addr)
+		}
+	}
+}
+
+// drain removes every host this listener has ever reported, used once
+// UnSubscribe succeeds so the cluster stops routing to providers we're no
+// longer watching. It leaves any hosts an application-level listener has
+// contributed to the same cluster name in place.
+func (l *listener) drain() {
+	l.mu.Lock()
+	l.hosts = map[string]*hostState{}
+	pushed := l.pushed
+	l.pushed = map[string]struct{}{}
+	if l.debounce != nil {
+		l.debounce.Stop()
+		l.debounce = nil
+	}
+	l.mu.Unlock()
+
+	for addr := range pushed {
+		removeClusterHostEntry(l.servicePath, addr)
+	}
+	untrackListenerStaleness(l.servicePath)
+}
+
+// effectiveWeight ramps a host from a small fraction of its configured
+// weight up to the full value over warmupMS, matching dubbo's own
+// client-side warm-up behaviour.
+func effectiveWeight(hs *hostState) uint32 {
+	if hs.warmupMS == 0 {
+		return hs.weight
+	}
+	elapsed := time.Since(hs.registered)
+	if elapsed >= time.Duration(hs.warmupMS)*time.Millisecond {
+		return hs.weight
+	}
+	ratio := float64(elapsed) / float64(time.Duration(hs.warmupMS)*time.Millisecond)
+	weight := uint32(float64(hs.weight) * ratio)
+	if weight == 0 {
+		weight = 1
+	}
+	return weight
+}
+
+func parseWeight(u dubbocommon.URL) uint32 {
+	return parseURLUint(u, "weight", defaultHostWeight)
+}
+
+func parseWarmup(u dubbocommon.URL) uint32 {
+	return parseURLUint(u, "warmup", 0)
+}
+
+func parseURLUint(u dubbocommon.URL, key string, def uint32) uint32 {
+	raw := u.GetParam(key, "")
+	if raw == "" {
+		return def
+	}
+	var v uint32
+	if _, err := fmt.Sscanf(raw, "%d", &v); err != nil {
+		return def
+	}
+	return v
+}
+
+// liveListeners backs the staleness poller: every listener that currently
+// has an active subscription is tracked here by servicePath so operators can
+// alert on a registry that's stopped delivering events.
+var liveListeners = sync.Map{} // servicePath -> *listener
+
+var startStalenessPoller = sync.OnceFunc(func() {
+	go func() {
+		ticker := time.NewTicker(stalenessPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			liveListeners.Range(func(k, v interface{}) bool {
+				servicePath := k.(string)
+				l := v.(*listener)
+
+				l.mu.Lock()
+				staleness := time.Since(l.lastEventAt)
+				warming := false
+				for _, hs := range l.hosts {
+					if hs.warmupMS > 0 && time.Since(hs.registered) < time.Duration(hs.warmupMS)*time.Millisecond {
+						warming = true
+						break
+					}
+				}
+				l.mu.Unlock()
+
+				setGauge(servicePath, metricSubscriptionStaleness, int64(staleness.Seconds()))
+				if warming {
+					l.flush()
+				}
+				return true
+			})
+		}
+	}()
+})
+
+func trackListenerStaleness(servicePath string, l *listener) {
+	l.mu.Lock()
+	l.lastEventAt = time.Now()
+	l.mu.Unlock()
+	liveListeners.Store(servicePath, l)
+	startStalenessPoller()
+}
+
+func untrackListenerStaleness(servicePath string) {
+	liveListeners.Delete(servicePath)
+	log.DefaultLogger.Infof("dubbod: stopped watching %s, hosts drained", servicePath)
+}
@@ -0,0 +1,119 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	dubbocommon "github.com/mosn/registry/dubbo/common"
+)
+
+func TestParseWeight(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  string
+		want uint32
+	}{
+		{"explicit weight", "50", 50},
+		{"absent falls back to default", "", defaultHostWeight},
+		{"non-numeric falls back to default", "nope", defaultHostWeight},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := urlWithParam(t, "weight", tc.raw)
+			if got := parseWeight(*u); got != tc.want {
+				t.Errorf("parseWeight() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseWarmup(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  string
+		want uint32
+	}{
+		{"explicit warmup", "5000", 5000},
+		{"absent defaults to no warmup", "", 0},
+		{"non-numeric defaults to no warmup", "nope", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := urlWithParam(t, "warmup", tc.raw)
+			if got := parseWarmup(*u); got != tc.want {
+				t.Errorf("parseWarmup() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func urlWithParam(t *testing.T, key, value string) *dubbocommon.URL {
+	t.Helper()
+	params := url.Values{}
+	if value != "" {
+		params.Set(key, value)
+	}
+	return dubbocommon.NewURLWithOptions(dubbocommon.WithParams(params))
+}
+
+func TestEffectiveWeight(t *testing.T) {
+	cases := []struct {
+		name string
+		hs   *hostState
+		want uint32
+	}{
+		{
+			name: "no warmup returns full weight",
+			hs:   &hostState{weight: 100, warmupMS: 0, registered: time.Now()},
+			want: 100,
+		},
+		{
+			name: "warmup elapsed returns full weight",
+			hs:   &hostState{weight: 100, warmupMS: 1000, registered: time.Now().Add(-2 * time.Second)},
+			want: 100,
+		},
+		{
+			name: "mid-warmup returns a reduced, non-zero weight",
+			hs:   &hostState{weight: 100, warmupMS: 10000, registered: time.Now().Add(-5 * time.Second)},
+			want: 50,
+		},
+		{
+			name: "just-registered still ramps to at least 1, never 0",
+			hs:   &hostState{weight: 100, warmupMS: 10000, registered: time.Now()},
+			want: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := effectiveWeight(tc.hs)
+			// mid-warmup timing is inherently approximate; only check that the
+			// weight is reduced and non-zero, not that it equals want exactly.
+			if tc.name == "mid-warmup returns a reduced, non-zero weight" {
+				if got == 0 || got >= tc.hs.weight {
+					t.Errorf("effectiveWeight() = %d, want strictly between 0 and %d", got, tc.hs.weight)
+				}
+				return
+			}
+			if got != tc.want {
+				t.Errorf("effectiveWeight() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
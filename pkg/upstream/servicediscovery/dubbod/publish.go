@@ -0,0 +1,186 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	dubbocommon "github.com/mosn/registry/dubbo/common"
+	dubboconsts "github.com/mosn/registry/dubbo/common/constant"
+)
+
+// providerServiceInfo identifies the local service a provider is exporting
+// and how to reach it, carried on publish/unpublish requests.
+type providerServiceInfo struct {
+	Interface     string   `json:"interface"`
+	Application   string   `json:"application"`
+	Group         string   `json:"group"`
+	Version       string   `json:"version"`
+	Methods       []string `json:"methods"`
+	Serialization string   `json:"serialization"`
+	Ip            string   `json:"ip"`
+	Port          string   `json:"port"`
+	// AdminPort is the port MOSN's admin listener serves metadataHTTPPath
+	// on for this instance. It's stamped onto the dubbo registration as
+	// adminPortParamKey so application-level discovery knows where to fetch
+	// this instance's metadata from, since Port above is the dubbo protocol
+	// port, not the admin one.
+	AdminPort string `json:"adminPort"`
+}
+
+type pubReq struct {
+	Registry registryInfo        `json:"registry"`
+	Service  providerServiceInfo `json:"service"`
+}
+
+type unpubReq struct {
+	Registry registryInfo        `json:"registry"`
+	Service  providerServiceInfo `json:"service"`
+}
+
+// publishedService is the metadata cache entry for one exported interface,
+// served back out of metadataHTTPPath.
+type publishedService struct {
+	registry registryInfo
+	url      dubbocommon.URL
+	meta     interfaceMetadata
+}
+
+// publishedServices caches everything this instance has published, keyed by
+// interface. It backs the local metadata endpoint the application-level
+// discovery listeners hit, and lets unpublish/Shutdown deregister cleanly.
+var publishedServices = sync.Map{} // servicePath -> *publishedService
+
+// publish registers a local Dubbo provider through MOSN so the sidecar owns
+// the registry interaction on behalf of co-located services.
+func publish(w http.ResponseWriter, r *http.Request) {
+	var req pubReq
+	err := bind(r, &req)
+	if err != nil {
+		response(w, resp{Errno: fail, ErrMsg: "publish fail, err: " + err.Error()})
+		return
+	}
+
+	servicePath := req.Service.Interface
+	reg, err := getRegistry(servicePath, dubbocommon.PROVIDER, req.Registry)
+	if err != nil {
+		response(w, resp{Errno: fail, ErrMsg: "publish fail, err: " + err.Error()})
+		return
+	}
+
+	dubboURL := dubbocommon.NewURLWithOptions(
+		dubbocommon.WithPath(servicePath),
+		dubbocommon.WithProtocol("dubbo"),
+		dubbocommon.WithIp(req.Service.Ip),
+		dubbocommon.WithPort(req.Service.Port),
+		dubbocommon.WithParams(url.Values{
+			dubboconsts.TIMESTAMP_KEY:     []string{fmt.Sprint(time.Now().Unix())},
+			dubboconsts.ROLE_KEY:          []string{fmt.Sprint(dubbocommon.PROVIDER)},
+			dubboconsts.GROUP_KEY:         []string{req.Service.Group},
+			dubboconsts.VERSION_KEY:       []string{req.Service.Version},
+			dubboconsts.APPLICATION_KEY:   []string{req.Service.Application},
+			dubboconsts.SERIALIZATION_KEY: []string{req.Service.Serialization},
+			dubboconsts.SIDE_KEY:          []string{dubboconsts.PROVIDER_SIDE},
+			adminPortParamKey:             []string{req.Service.AdminPort},
+		}),
+		dubbocommon.WithMethods(req.Service.Methods))
+
+	if err := reg.Register(*dubboURL); err != nil {
+		response(w, resp{Errno: fail, ErrMsg: "publish fail, err: " + err.Error()})
+		return
+	}
+
+	publishedServices.Store(servicePath, &publishedService{
+		registry: req.Registry,
+		url:      *dubboURL,
+		meta: interfaceMetadata{
+			Interface: servicePath,
+			Methods:   req.Service.Methods,
+		},
+	})
+
+	response(w, resp{Errno: succ, ErrMsg: "publish success"})
+}
+
+// unpublish deregisters a previously published provider and drops it from
+// the metadata cache.
+func unpublish(w http.ResponseWriter, r *http.Request) {
+	var req unpubReq
+	err := bind(r, &req)
+	if err != nil {
+		response(w, resp{Errno: fail, ErrMsg: "unpublish fail, err: " + err.Error()})
+		return
+	}
+
+	servicePath := req.Service.Interface
+	v, ok := publishedServices.Load(servicePath)
+	if !ok {
+		response(w, resp{Errno: fail, ErrMsg: "unpublish fail, err: service not published"})
+		return
+	}
+	ps := v.(*publishedService)
+
+	reg, err := getRegistry(servicePath, dubbocommon.PROVIDER, req.Registry)
+	if err != nil {
+		response(w, resp{Errno: fail, ErrMsg: "unpublish fail, err: " + err.Error()})
+		return
+	}
+
+	if err := reg.UnRegister(ps.url); err != nil {
+		response(w, resp{Errno: fail, ErrMsg: "unpublish fail, err: " + err.Error()})
+		return
+	}
+	publishedServices.Delete(servicePath)
+
+	response(w, resp{Errno: succ, ErrMsg: "unpublish success"})
+}
+
+// metadata serves the interfaces/methods this instance has published, over
+// the same admin listener as subscribe/publish. Application-level discovery
+// listeners (see appdiscovery.go) hit this on every instance they see added.
+func metadata(w http.ResponseWriter, r *http.Request) {
+	var meta instanceMetadata
+	publishedServices.Range(func(_, v interface{}) bool {
+		meta.Interfaces = append(meta.Interfaces, v.(*publishedService).meta)
+		return true
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(meta)
+}
+
+// Shutdown deregisters every service this instance has published and
+// flushes the metadata cache. It should be invoked from MOSN's graceful
+// shutdown path.
+func Shutdown() {
+	publishedServices.Range(func(k, v interface{}) bool {
+		servicePath := k.(string)
+		ps := v.(*publishedService)
+
+		reg, err := getRegistry(servicePath, dubbocommon.PROVIDER, ps.registry)
+		if err == nil {
+			_ = reg.UnRegister(ps.url)
+		}
+		publishedServices.Delete(servicePath)
+		return true
+	})
+}
@@ -0,0 +1,70 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadataHandler(t *testing.T) {
+	publishedServices.Store("com.mosn.test.UserService", &publishedService{
+		meta: interfaceMetadata{
+			Interface: "com.mosn.test.UserService",
+			Methods:   []string{"getUser"},
+		},
+	})
+	defer publishedServices.Delete("com.mosn.test.UserService")
+
+	req := httptest.NewRequest(http.MethodGet, metadataHTTPPath, nil)
+	rec := httptest.NewRecorder()
+	metadata(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var got instanceMetadata
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	found := false
+	for _, im := range got.Interfaces {
+		if im.Interface == "com.mosn.test.UserService" {
+			found = true
+			if len(im.Methods) != 1 || im.Methods[0] != "getUser" {
+				t.Errorf("Methods = %v, want [getUser]", im.Methods)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("response %+v does not include the published service", got)
+	}
+}
+
+func TestRegisterHandlersWiresMetadataPath(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux)
+
+	_, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, metadataHTTPPath, nil))
+	if pattern != metadataHTTPPath {
+		t.Errorf("mux pattern for %s = %q, want the exact path registered", metadataHTTPPath, pattern)
+	}
+}
@@ -0,0 +1,318 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	registry "github.com/mosn/registry/dubbo"
+	dubbocommon "github.com/mosn/registry/dubbo/common"
+	dubboconsts "github.com/mosn/registry/dubbo/common/constant"
+	"github.com/valyala/fasttemplate"
+	"mosn.io/mosn/pkg/log"
+)
+
+// defaultRegistryType is assumed when a request does not set registry.type,
+// preserving dubbod's behaviour from before backends became pluggable.
+const defaultRegistryType = "zookeeper"
+
+// RegistryBackend is the minimal surface dubbod needs out of a registry
+// client, mirroring github.com/mosn/registry/dubbo.Registry so that
+// alternative backends (Nacos, Consul, etcd, k8s, ...) can be registered
+// without this package depending on their client libraries. See doc.go for
+// the external API shape this package assumes.
+type RegistryBackend interface {
+	Register(url dubbocommon.URL) error
+	UnRegister(url dubbocommon.URL) error
+	Subscribe(url *dubbocommon.URL, listener registry.NotifyListener) error
+	UnSubscribe(url *dubbocommon.URL, listener registry.NotifyListener) error
+}
+
+// RegistryBackendFactory builds a RegistryBackend connected to registryURL.
+type RegistryBackendFactory func(registryURL dubbocommon.URL) (RegistryBackend, error)
+
+var registryBackendFactories = struct {
+	mu sync.RWMutex
+	m  map[string]RegistryBackendFactory
+}{m: map[string]RegistryBackendFactory{
+	defaultRegistryType: func(registryURL dubbocommon.URL) (RegistryBackend, error) {
+		return registry.GetRegistry(&registryURL)
+	},
+}}
+
+// RegisterRegistryBackend registers a named registry backend, e.g. "nacos",
+// "consul", "etcd" or "k8s", so operators can select it via registry.type
+// without dubbod depending on its implementation. Typically called from an
+// extension's init().
+func RegisterRegistryBackend(name string, factory RegistryBackendFactory) {
+	registryBackendFactories.mu.Lock()
+	defer registryBackendFactories.mu.Unlock()
+	registryBackendFactories.m[name] = factory
+}
+
+func getRegistryBackendFactory(name string) (RegistryBackendFactory, error) {
+	registryBackendFactories.mu.RLock()
+	defer registryBackendFactories.mu.RUnlock()
+	f, ok := registryBackendFactories.m[name]
+	if !ok {
+		return nil, fmt.Errorf("registry backend %q is not registered", name)
+	}
+	return f, nil
+}
+
+// registrySchemeTpl renders the registry connection URL for each backend
+// type. A backend registered by an extension that doesn't need a scheme of
+// its own can reuse "zookeeper" or add its own entry here.
+var registrySchemeTpl = map[string]*fasttemplate.Template{
+	"zookeeper": fasttemplate.New("zookeeper://{addr}", "{", "}"),
+	"nacos":     fasttemplate.New("nacos://{addr}", "{", "}"),
+	"consul":    fasttemplate.New("consul://{addr}", "{", "}"),
+	"etcd":      fasttemplate.New("etcd3://{addr}", "{", "}"),
+	"k8s":       fasttemplate.New("k8s://{addr}", "{", "}"),
+}
+
+func buildRegistryURL(reg registryInfo) dubbocommon.URL {
+	tpl, ok := registrySchemeTpl[reg.Type]
+	if !ok {
+		tpl = registrySchemeTpl[defaultRegistryType]
+	}
+	path := tpl.ExecuteString(map[string]interface{}{"addr": reg.Addr})
+	registryURL, _ := dubbocommon.NewURL(path,
+		dubbocommon.WithParams(url.Values{
+			dubboconsts.REGISTRY_TIMEOUT_KEY: []string{"5s"},
+		}),
+		dubbocommon.WithUsername(reg.UserName),
+		dubbocommon.WithPassword(reg.Password),
+	)
+	return registryURL
+}
+
+type registryCacheKey struct {
+	typ      string
+	addr     string
+	username string
+	password string
+}
+
+// registryBackendCache caches one client per (type, addr, credentials)
+// tuple, so repeated subscribe/publish calls against the same registry don't
+// each open their own session.
+var registryBackendCache = sync.Map{} // registryCacheKey -> RegistryBackend
+
+// getRegistry resolves, creating and caching it on first use, the backend
+// identified by reg.Type/Addr/credentials.
+func getRegistry(servicePath string, role dubbocommon.RoleType, reg registryInfo) (RegistryBackend, error) {
+	key := registryInfoCacheKey(reg)
+	if v, ok := registryBackendCache.Load(key); ok {
+		return v.(RegistryBackend), nil
+	}
+
+	factory, err := getRegistryBackendFactory(key.typ)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := factory(buildRegistryURL(reg))
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s registry %s: %w", key.typ, reg.Addr, err)
+	}
+
+	registryBackendCache.Store(key, backend)
+	return backend, nil
+}
+
+func registryInfoCacheKey(reg registryInfo) registryCacheKey {
+	typ := reg.Type
+	if typ == "" {
+		typ = defaultRegistryType
+	}
+	return registryCacheKey{typ: typ, addr: reg.Addr, username: reg.UserName, password: reg.Password}
+}
+
+// evictRegistry drops reg's cached backend so the next getRegistry call for
+// it builds a fresh client instead of handing back one whose session is
+// already known dead.
+func evictRegistry(reg registryInfo) {
+	registryBackendCache.Delete(registryInfoCacheKey(reg))
+}
+
+// registerWithFailover registers dubboURL against the registries in regs, in
+// order, succeeding as soon as one accepts it.
+func registerWithFailover(servicePath string, role dubbocommon.RoleType, regs []registryInfo, dubboURL dubbocommon.URL) (RegistryBackend, error) {
+	var lastErr error
+	for _, reg := range regs {
+		backend, err := getRegistry(servicePath, role, reg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := backend.Register(dubboURL); err != nil {
+			lastErr = err
+			continue
+		}
+		return backend, nil
+	}
+	return nil, fmt.Errorf("register %s against all registries failed, last error: %v", servicePath, lastErr)
+}
+
+// unregisterWithFailover mirrors registerWithFailover for UnRegister.
+func unregisterWithFailover(servicePath string, role dubbocommon.RoleType, regs []registryInfo, dubboURL dubbocommon.URL) error {
+	var lastErr error
+	for _, reg := range regs {
+		backend, err := getRegistry(servicePath, role, reg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := backend.UnRegister(dubboURL); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("unregister %s against all registries failed, last error: %v", servicePath, lastErr)
+}
+
+// subscribeRetryBackoff bounds how fast subscribeWithFailover re-enters its
+// registry list once every backend in it has returned, so a registry whose
+// Subscribe returns promptly (or an instantly-dead session) can't spin the
+// failover loop at 100% CPU.
+const subscribeRetryBackoff = 2 * time.Second
+
+// subscribeWithFailover subscribes dubboURL against the registries in regs,
+// primary first, until ctx is cancelled. Registry.Subscribe blocks for as
+// long as the session is alive, so this loops over regs in order and moves
+// on to the next one whenever the current backend's Subscribe call returns,
+// whether that's because it errored or because its session died; in steady
+// state that means it parks on the primary and only falls over on failure.
+// l is expected to be the same listener instance (typically a
+// *dedupingListener wrapping the caller's real listener) that will later be
+// passed to unsubscribeWithFailover, since a registry that identifies
+// listeners by reference won't recognize a different wrapper at UnSubscribe
+// time. The caller must cancel ctx on unsubscribe - this loop does not stop
+// on its own once it's parked on a live registry.
+func subscribeWithFailover(ctx context.Context, servicePath string, regs []registryInfo, dubboURL *dubbocommon.URL, l registry.NotifyListener) error {
+	if len(regs) == 0 {
+		return fmt.Errorf("subscribe %s: no registry configured", servicePath)
+	}
+
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		failedAll := true
+		for i, reg := range regs {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
+			backend, err := getRegistry(servicePath, dubbocommon.CONSUMER, reg)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			failedAll = false
+			subErr := backend.Subscribe(dubboURL, l)
+			if subErr != nil {
+				lastErr = subErr
+				// The cached client's session is suspect once Subscribe
+				// has returned in error; evict it so the next round
+				// through regs reconnects instead of handing back the
+				// same dead backend.
+				evictRegistry(reg)
+			}
+			log.DefaultLogger.Errorf("dubbod: subscribe to registry #%d for %s ended, failing over: %v", i, servicePath, subErr)
+		}
+		if failedAll {
+			return fmt.Errorf("subscribe %s against all registries failed, last error: %v", servicePath, lastErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(subscribeRetryBackoff):
+		}
+	}
+}
+
+// unsubscribeWithFailover mirrors subscribeWithFailover for UnSubscribe. l
+// must be the same instance passed to the matching subscribeWithFailover
+// call.
+func unsubscribeWithFailover(servicePath string, regs []registryInfo, dubboURL *dubbocommon.URL, l registry.NotifyListener) error {
+	var lastErr error
+	for _, reg := range regs {
+		backend, err := getRegistry(servicePath, dubbocommon.CONSUMER, reg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := backend.UnSubscribe(dubboURL, l); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("unsubscribe %s against all registries failed, last error: %v", servicePath, lastErr)
+}
+
+// dedupingListener suppresses repeat ADD notifications for a provider URL
+// already known, so failing over from one registry source to another does
+// not double-count a provider both happen to report. UPDATE is always
+// forwarded - it's how listener.Notify (listener.go) and appListener.Notify
+// (appdiscovery.go) learn about weight/warmup changes on a provider already
+// seen, and suppressing it would silently freeze those at their ADD-time
+// values.
+type dedupingListener struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	next registry.NotifyListener
+}
+
+func newDedupingListener(next registry.NotifyListener) *dedupingListener {
+	return &dedupingListener{seen: map[string]struct{}{}, next: next}
+}
+
+func (d *dedupingListener) Notify(event *registry.ServiceEvent) {
+	key := event.Service.Key()
+
+	switch event.Action {
+	case registry.ServiceEventDel:
+		d.mu.Lock()
+		delete(d.seen, key)
+		d.mu.Unlock()
+	case registry.ServiceEventAdd:
+		d.mu.Lock()
+		if _, ok := d.seen[key]; ok {
+			d.mu.Unlock()
+			return
+		}
+		d.seen[key] = struct{}{}
+		d.mu.Unlock()
+	}
+	// ServiceEventUpdate, and anything else, always forwarded.
+
+	d.next.Notify(event)
+}
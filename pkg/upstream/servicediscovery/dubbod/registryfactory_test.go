@@ -0,0 +1,139 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"fmt"
+	"testing"
+
+	registry "github.com/mosn/registry/dubbo"
+	dubbocommon "github.com/mosn/registry/dubbo/common"
+)
+
+// fakeRegistryBackend is a minimal, in-memory RegistryBackend used to drive
+// registerWithFailover/unregisterWithFailover without a real registry
+// client.
+type fakeRegistryBackend struct {
+	registerErr error
+	registered  []dubbocommon.URL
+}
+
+func (f *fakeRegistryBackend) Register(url dubbocommon.URL) error {
+	if f.registerErr != nil {
+		return f.registerErr
+	}
+	f.registered = append(f.registered, url)
+	return nil
+}
+
+func (f *fakeRegistryBackend) UnRegister(url dubbocommon.URL) error { return nil }
+func (f *fakeRegistryBackend) Subscribe(url *dubbocommon.URL, l registry.NotifyListener) error {
+	return nil
+}
+func (f *fakeRegistryBackend) UnSubscribe(url *dubbocommon.URL, l registry.NotifyListener) error {
+	return nil
+}
+
+func TestRegisterWithFailover(t *testing.T) {
+	primary := &fakeRegistryBackend{registerErr: fmt.Errorf("primary down")}
+	secondary := &fakeRegistryBackend{}
+
+	restore := registryBackendFactories.m
+	registryBackendFactories.m = map[string]RegistryBackendFactory{
+		"primary":   func(dubbocommon.URL) (RegistryBackend, error) { return primary, nil },
+		"secondary": func(dubbocommon.URL) (RegistryBackend, error) { return secondary, nil },
+	}
+	defer func() { registryBackendFactories.m = restore }()
+
+	regs := []registryInfo{
+		{Type: "primary", Addr: "z1:2181"},
+		{Type: "secondary", Addr: "z2:2181"},
+	}
+	dubboURL := dubbocommon.NewURLWithOptions(dubbocommon.WithPath("com.mosn.test.UserService"))
+
+	backend, err := registerWithFailover("com.mosn.test.UserService", dubbocommon.PROVIDER, regs, *dubboURL)
+	if err != nil {
+		t.Fatalf("registerWithFailover() error = %v", err)
+	}
+	if backend != secondary {
+		t.Errorf("registerWithFailover() backend = %p, want the secondary backend %p", backend, secondary)
+	}
+	if len(secondary.registered) != 1 {
+		t.Errorf("secondary.registered = %d entries, want 1", len(secondary.registered))
+	}
+	if len(primary.registered) != 0 {
+		t.Errorf("primary.registered = %d entries, want 0 (its Register call failed)", len(primary.registered))
+	}
+}
+
+func TestRegisterWithFailoverAllFail(t *testing.T) {
+	restore := registryBackendFactories.m
+	registryBackendFactories.m = map[string]RegistryBackendFactory{
+		"bad": func(dubbocommon.URL) (RegistryBackend, error) { return nil, fmt.Errorf("connect refused") },
+	}
+	defer func() { registryBackendFactories.m = restore }()
+
+	regs := []registryInfo{{Type: "bad", Addr: "z1:2181"}}
+	dubboURL := dubbocommon.NewURLWithOptions(dubbocommon.WithPath("com.mosn.test.UserService"))
+
+	if _, err := registerWithFailover("com.mosn.test.UserService", dubbocommon.PROVIDER, regs, *dubboURL); err == nil {
+		t.Fatal("registerWithFailover() error = nil, want an error when every registry fails")
+	}
+}
+
+// capturingListener records every event it's asked to forward.
+type capturingListener struct {
+	events []*registry.ServiceEvent
+}
+
+func (c *capturingListener) Notify(event *registry.ServiceEvent) {
+	c.events = append(c.events, event)
+}
+
+func TestDedupingListener(t *testing.T) {
+	next := &capturingListener{}
+	d := newDedupingListener(next)
+
+	u := dubbocommon.NewURLWithOptions(
+		dubbocommon.WithPath("com.mosn.test.UserService"),
+		dubbocommon.WithIp("10.0.0.1"),
+		dubbocommon.WithPort("20880"),
+	)
+
+	d.Notify(&registry.ServiceEvent{Service: *u, Action: registry.ServiceEventAdd})
+	d.Notify(&registry.ServiceEvent{Service: *u, Action: registry.ServiceEventAdd})
+	if len(next.events) != 1 {
+		t.Fatalf("after two ADDs, forwarded %d events, want 1 (second ADD should be deduped)", len(next.events))
+	}
+
+	d.Notify(&registry.ServiceEvent{Service: *u, Action: registry.ServiceEventUpdate})
+	if len(next.events) != 2 {
+		t.Fatalf("after an UPDATE on an already-seen provider, forwarded %d events, want 2 (UPDATE must always forward)", len(next.events))
+	}
+
+	d.Notify(&registry.ServiceEvent{Service: *u, Action: registry.ServiceEventDel})
+	if len(next.events) != 3 {
+		t.Fatalf("after DEL, forwarded %d events, want 3", len(next.events))
+	}
+
+	// Once deleted, the same provider ADD-ing again is a fresh instance, not
+	// a duplicate, and must be forwarded.
+	d.Notify(&registry.ServiceEvent{Service: *u, Action: registry.ServiceEventAdd})
+	if len(next.events) != 4 {
+		t.Fatalf("after re-ADD post-DEL, forwarded %d events, want 4", len(next.events))
+	}
+}
@@ -17,8 +17,8 @@
 package dubbod
 
 import (
+	"context"
 	"fmt"
-	registry "github.com/mosn/registry/dubbo"
 	dubbocommon "github.com/mosn/registry/dubbo/common"
 	dubboconsts "github.com/mosn/registry/dubbo/common/constant"
 	v2 "mosn.io/mosn/pkg/config/v2"
@@ -30,7 +30,7 @@ import (
 	"time"
 )
 
-// map[string]registry.NotifyListener{}
+// map[string]*listener{}
 var dubboInterface2listener = sync.Map{}
 
 // inject a router to router manager
@@ -53,6 +53,21 @@ func initRouterManager() {
 	}
 }
 
+// RegisterHandlers wires dubbod's HTTP endpoints onto mux: subscribe and
+// unsubscribe here, plus publish/unpublish/metadata from publish.go. Nothing
+// in this package registers itself on an admin listener on its own, so
+// MOSN's admin server must call this once during startup (alongside
+// initRouterManager) for any of these endpoints - including metadataHTTPPath,
+// which every other instance's application-level discovery depends on being
+// served - to actually be reachable.
+func RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/dubbod/subscribe", subscribe)
+	mux.HandleFunc("/dubbod/unsubscribe", unsubscribe)
+	mux.HandleFunc("/dubbod/publish", publish)
+	mux.HandleFunc("/dubbod/unpublish", unpublish)
+	mux.HandleFunc(metadataHTTPPath, metadata)
+}
+
 // subscribe a service from registry
 func subscribe(w http.ResponseWriter, r *http.Request) {
 	var req subReq
@@ -62,24 +77,19 @@ func subscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var registryPath = registryPathTpl.ExecuteString(map[string]interface{}{
-		"addr": req.Registry.Addr,
-	})
-	registryURL, _ := dubbocommon.NewURL(registryPath,
-		dubbocommon.WithParams(url.Values{
-			dubboconsts.REGISTRY_TIMEOUT_KEY: []string{"5s"},
-		}),
-		dubbocommon.WithUsername(req.Registry.UserName),
-		dubbocommon.WithPassword(req.Registry.Password),
-	)
-
-	servicePath := req.Service.Interface // com.mosn.test.UserService
-	reg, err := getRegistry(servicePath, dubbocommon.CONSUMER, registryURL)
-	if err != nil {
-		response(w, resp{Errno: fail, ErrMsg: "subscribe fail, err: " + err.Error()})
+	// application-level registration replaces the legacy per-interface flow
+	// below when the caller supplies an application name.
+	if req.Service.Application != "" {
+		if err := subscribeByApp(req); err != nil {
+			response(w, resp{Errno: fail, ErrMsg: "subscribe fail, err: " + err.Error()})
+			return
+		}
+		response(w, resp{Errno: succ, ErrMsg: "subscribe success"})
 		return
 	}
 
+	servicePath := req.Service.Interface // com.mosn.test.UserService
+
 	dubboURL := dubbocommon.NewURLWithOptions(
 		dubbocommon.WithPath(servicePath),
 		dubbocommon.WithProtocol("dubbo"), // this protocol is used to compare the url, must provide
@@ -90,16 +100,22 @@ func subscribe(w http.ResponseWriter, r *http.Request) {
 		}),
 		dubbocommon.WithMethods(req.Service.Methods))
 
-	// register consumer to registry
-	err = reg.Register(*dubboURL)
-	if err != nil {
+	// register consumer to registry, falling back through req.Registry in order
+	if _, err := registerWithFailover(servicePath, dubbocommon.CONSUMER, req.Registry, *dubboURL); err != nil {
 		response(w, resp{Errno: fail, ErrMsg: "subscribe fail, err: " + err.Error()})
 		return
 	}
 
-	// listen to provider change events
-	var l = &listener{}
-	go reg.Subscribe(dubboURL, l)
+	// listen to provider change events, failing over across req.Registry
+	// whenever the active backend's Subscribe call returns (error or dead
+	// session). l.dedup is the exact listener instance handed to Subscribe
+	// so unsubscribe can hand the same one to UnSubscribe; l.cancel stops
+	// the goroutine once unsubscribe is done with it.
+	var l = newListener(servicePath)
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.dedup = newDedupingListener(l)
+	go subscribeWithFailover(ctx, servicePath, req.Registry, dubboURL, l.dedup)
 	dubboInterface2listener.Store(servicePath, l)
 
 	err = addRouteRule(servicePath)
@@ -120,24 +136,17 @@ func unsubscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var registryPath = registryPathTpl.ExecuteString(map[string]interface{}{
-		"addr": req.Registry.Addr,
-	})
-	registryURL, _ := dubbocommon.NewURL(registryPath,
-		dubbocommon.WithParams(url.Values{
-			dubboconsts.REGISTRY_TIMEOUT_KEY: []string{"5s"},
-		}),
-		dubbocommon.WithUsername(req.Registry.UserName),
-		dubbocommon.WithPassword(req.Registry.Password),
-	)
-
-	servicePath := req.Service.Interface // com.mosn.test.UserService
-	reg, err := getRegistry(servicePath, dubbocommon.CONSUMER, registryURL)
-	if err != nil {
-		response(w, resp{Errno: fail, ErrMsg: "unsubscribe fail, err: " + err.Error()})
+	if req.Service.Application != "" {
+		if err := unsubscribeByApp(req); err != nil {
+			response(w, resp{Errno: fail, ErrMsg: "unsubscribe fail, err: " + err.Error()})
+			return
+		}
+		response(w, resp{Errno: succ, ErrMsg: "unsubscribe success"})
 		return
 	}
 
+	servicePath := req.Service.Interface // com.mosn.test.UserService
+
 	dubboURL := dubbocommon.NewURLWithOptions(
 		dubbocommon.WithPath(servicePath),
 		dubbocommon.WithProtocol("dubbo"), // this protocol is used to compare the url, must provide
@@ -148,27 +157,38 @@ func unsubscribe(w http.ResponseWriter, r *http.Request) {
 		}),
 		dubbocommon.WithMethods(req.Service.Methods))
 
-	// unregister consumer
-	err = reg.UnRegister(*dubboURL)
-	if err != nil {
+	// unregister consumer, trying each registry in req.Registry in order
+	if err := unregisterWithFailover(servicePath, dubbocommon.CONSUMER, req.Registry, *dubboURL); err != nil {
 		response(w, resp{Errno: fail, ErrMsg: "unsubscribe fail, err: " + err.Error()})
 		return
 	}
 
-	l, ok := dubboInterface2listener.Load(servicePath)
-	if ok {
-		err = reg.UnSubscribe(dubboURL, l.(registry.NotifyListener))
-	}
-
-	if err != nil {
-		response(w, resp{Errno: fail, ErrMsg: "unsubscribe fail, err: " + err.Error()})
-		return
+	if v, ok := dubboInterface2listener.Load(servicePath); ok {
+		dubboInterface2listener.Delete(servicePath)
+		l := v.(*listener)
+		// Stop the subscribeWithFailover goroutine before draining hosts,
+		// otherwise it can win a race and re-subscribe, repopulating the
+		// hosts drain() is about to remove.
+		l.cancel()
+		if err := unsubscribeWithFailover(servicePath, req.Registry, dubboURL, l.dedup); err != nil {
+			response(w, resp{Errno: fail, ErrMsg: "unsubscribe fail, err: " + err.Error()})
+			return
+		}
+		l.drain()
 	}
 
 	response(w, resp{Errno: succ, ErrMsg: "unsubscribe success"})
 }
 
 var dubboInterface2registerFlag = sync.Map{}
+
+// addRouteRule installs the default single-cluster route a subscribed
+// service gets unless/until the config center (configcenter.go) pushes an
+// explicit virtual service document for the same servicePath. It writes
+// through the same serviceRoutes table the config center does, rather than
+// calling the router manager directly, so a later config-center push
+// replaces this entry instead of wiping every other service's routes out
+// from under it.
 func addRouteRule(servicePath string) error {
 	// if already route rule of this service is already added to router manager
 	// then skip
@@ -177,21 +197,23 @@ func addRouteRule(servicePath string) error {
 	}
 
 	dubboInterface2registerFlag.Store(servicePath, struct{}{})
-	return routerAdapter.GetRoutersMangerInstance().AddRoute(dubboRouterConfigName, "*", &v2.Router{
-		RouterConfig: v2.RouterConfig{
-			Match: v2.RouterMatch{
-				Headers: []v2.HeaderMatcher{
-					{
-						Name:  "service", // use the xprotocol header field "service"
-						Value: servicePath,
+	return replaceServiceRoutes(servicePath, []*v2.Router{
+		{
+			RouterConfig: v2.RouterConfig{
+				Match: v2.RouterMatch{
+					Headers: []v2.HeaderMatcher{
+						{
+							Name:  "service", // use the xprotocol header field "service"
+							Value: servicePath,
+						},
 					},
 				},
-			},
-			Route: v2.RouteAction{
-				RouterActionConfig: v2.RouterActionConfig{
-					ClusterName: servicePath,
+				Route: v2.RouteAction{
+					RouterActionConfig: v2.RouterActionConfig{
+						ClusterName: servicePath,
+					},
 				},
 			},
 		},
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,81 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dubbod
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	dubboRouterConfigName = "dubbo"
+
+	succ = 0
+	fail = 1
+)
+
+// registryInfo describes how to reach one registry center. Type selects the
+// backend (see registryfactory.go) that Addr/UserName/Password are handed
+// to; it defaults to "zookeeper" when empty, matching dubbod's original
+// behaviour.
+type registryInfo struct {
+	Type     string `json:"type"`
+	Addr     string `json:"addr"`
+	UserName string `json:"username"`
+	Password string `json:"password"`
+}
+
+// serviceInfo identifies the dubbo service a request is about. Interface is
+// the traditional per-interface registration path; Application switches the
+// request onto the application-level discovery model, see subscribeByApp.
+type serviceInfo struct {
+	Interface   string   `json:"interface"`
+	Application string   `json:"application"`
+	Group       string   `json:"group"`
+	Version     string   `json:"version"`
+	Methods     []string `json:"methods"`
+}
+
+// subReq/unsubReq carry a list of registries, tried in order, so a
+// subscription can fail over from a primary registry to a secondary one
+// instead of failing outright.
+type subReq struct {
+	Registry []registryInfo `json:"registry"`
+	Service  serviceInfo    `json:"service"`
+}
+
+type unsubReq struct {
+	Registry []registryInfo `json:"registry"`
+	Service  serviceInfo    `json:"service"`
+}
+
+type resp struct {
+	Errno  int    `json:"errno"`
+	ErrMsg string `json:"errmsg"`
+}
+
+// bind decodes a JSON request body into v.
+func bind(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// response writes rp back to the caller as JSON.
+func response(w http.ResponseWriter, rp resp) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rp)
+}